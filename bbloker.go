@@ -1,8 +1,12 @@
 package bbloker
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Config holds all settings for the bbloker middleware.
@@ -31,18 +35,60 @@ type Config struct {
 	// Rate limit window duration. Default: 60 * time.Second
 	RateLimitWindow time.Duration
 
+	// RateLimiterBackend, if set, replaces the default in-process
+	// fixed-window limiter. Use RedisRateLimiterBackend to share a rate
+	// limit across replicas instead of counting independently per process.
+	// Default: nil, meaning the in-process limiter (RateLimit/RateLimitWindow).
+	RateLimiterBackend RateLimiterBackend
+
 	// Custom block handler. Default: 403 Forbidden with no body.
 	OnBlock func(w http.ResponseWriter, r *http.Request, d Decision)
+
+	// BypassFunc, if set, is checked before any other pipeline step. If it
+	// returns true for a request (e.g. because the request carries a valid
+	// session cookie), Analyze allows it immediately.
+	BypassFunc func(r *http.Request) bool
+
+	// RouteRules overrides AnomalyThreshold, RateLimit, and which checks
+	// run, per URL path. See RoutePolicy.
+	RouteRules map[string]RoutePolicy
+
+	// BlocklistSources are upstream IP/CIDR feeds (FireHOL, Spamhaus,
+	// MaxMind GeoLite2, CrowdSec CTI, ...) merged alongside the central
+	// bbloker API's BlockedIPs. Each is refreshed on its own schedule; see
+	// BlocklistSource.
+	BlocklistSources []BlocklistSource
+
+	// Store persists rule sets, rate-limiter windows, and undelivered
+	// telemetry across restarts. Default: nil, meaning no persistence —
+	// a restart falls back to hardcoded defaults and a clean rate-limit
+	// slate, as before. See SQLiteStore and BoltStore.
+	Store Store
+
+	// MetricsRegisterer, if set, registers Prometheus collectors
+	// (bbloker_requests_total, bbloker_analyze_duration_seconds,
+	// bbloker_header_anomaly_score, bbloker_rule_version,
+	// bbloker_rate_limit_windows_active, bbloker_telemetry_buffer_size).
+	// Default: nil, meaning no metrics are collected.
+	MetricsRegisterer prometheus.Registerer
+
+	// EventSink, if set, is called for every analyzed request with its
+	// Decision, for structured logging into Loki/Elastic/etc. without
+	// depending on the central bbloker telemetry endpoint.
+	EventSink func(ctx context.Context, d Decision, r *http.Request)
 }
 
 // Bbloker is the main client. Create one with New() and attach it as
 // middleware via Handler.
 type Bbloker struct {
-	config    Config
-	rules     *ruleManager
-	telemetry *telemetryClient
-	limiter   *rateLimiter
-	done      chan struct{}
+	config     Config
+	rules      *ruleManager
+	telemetry  *telemetryClient
+	limiter    *rateLimiter
+	blocklists *blocklistManager
+	routes     *routeTable
+	metrics    *metricsCollector
+	done       chan struct{}
 }
 
 // New creates a Bbloker instance, applies defaults, and starts background
@@ -70,24 +116,39 @@ func New(cfg Config) *Bbloker {
 	if cfg.RateLimitWindow == 0 {
 		cfg.RateLimitWindow = 60 * time.Second
 	}
+	if cfg.RateLimiterBackend != nil {
+		for pattern, policy := range cfg.RouteRules {
+			if policy.RateLimit != 0 {
+				log.Printf("bbloker: RouteRules[%q].RateLimit is ignored while Config.RateLimiterBackend is set; a shared distributed bucket has no per-route override", pattern)
+			}
+		}
+	}
 
 	done := make(chan struct{})
 
-	rm := newRuleManager(cfg.APIURL, cfg.APIKey, cfg.SyncInterval, done)
-	tc := newTelemetryClient(cfg.APIURL, cfg.APIKey, cfg.BufferSize, *cfg.Telemetry, cfg.FlushInterval, done)
-	rl := newRateLimiter(cfg.RateLimit, cfg.RateLimitWindow, done)
+	mc := newMetricsCollector(cfg.MetricsRegisterer)
+	rm := newRuleManager(cfg.APIURL, cfg.APIKey, cfg.SyncInterval, done, cfg.Store, mc)
+	tc := newTelemetryClient(cfg.APIURL, cfg.APIKey, cfg.BufferSize, *cfg.Telemetry, cfg.FlushInterval, done, cfg.Store, mc)
+	rl := newRateLimiter(cfg.RateLimit, cfg.RateLimitWindow, done, cfg.Store, mc)
+	bm := newBlocklistManager(cfg.BlocklistSources, done)
+	rt := newRouteTable(cfg.RouteRules)
 
 	return &Bbloker{
-		config:    cfg,
-		rules:     rm,
-		telemetry: tc,
-		limiter:   rl,
-		done:      done,
+		config:     cfg,
+		rules:      rm,
+		telemetry:  tc,
+		limiter:    rl,
+		blocklists: bm,
+		routes:     rt,
+		metrics:    mc,
+		done:       done,
 	}
 }
 
 // Close stops all background goroutines and flushes remaining telemetry.
+// It does not close Config.Store — the caller owns that lifecycle.
 func (b *Bbloker) Close() {
 	close(b.done)
+	b.limiter.persist()
 	b.telemetry.flush()
 }
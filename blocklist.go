@@ -0,0 +1,406 @@
+package bbloker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FetchState is opaque state a BlocklistSource can use to make conditional
+// requests (e.g. ETag / If-Modified-Since) on its next Fetch call.
+type FetchState struct {
+	ETag         string
+	LastModified string
+}
+
+// BlocklistSource is an upstream feed of IP/CIDR blocks, e.g. a FireHOL or
+// Spamhaus plain-text list, a MaxMind GeoLite2 CSV, or a CrowdSec CTI JSON
+// feed. Fetch is called on RefreshInterval and should return unchanged=true
+// (with a nil cidrs slice) when prev's conditional state indicates nothing
+// new is available.
+type BlocklistSource interface {
+	// Name identifies the source. Matches are recorded in Decision.Reason
+	// as "blocklist:<name>", so it should be short and stable.
+	Name() string
+
+	// RefreshInterval controls how often Fetch is called.
+	RefreshInterval() time.Duration
+
+	// TTL is how long a fetched snapshot remains valid if subsequent
+	// fetches fail; after TTL elapses with no successful refresh, the
+	// source's entries are dropped from the merged trie.
+	TTL() time.Duration
+
+	// Fetch retrieves the current CIDR list. prev is the state returned by
+	// the previous successful fetch, or nil on the first call.
+	Fetch(ctx context.Context, prev *FetchState) (cidrs []string, state *FetchState, unchanged bool, err error)
+}
+
+// blocklistManager fetches and merges one or more BlocklistSource feeds into
+// a single trie for lookup, refreshing each source on its own schedule.
+type blocklistManager struct {
+	mu      sync.RWMutex
+	merged  *ipTrie
+	entries map[string]blocklistEntry // source name -> last successful snapshot
+}
+
+type blocklistEntry struct {
+	cidrs     []string
+	state     *FetchState
+	expiresAt time.Time
+}
+
+func newBlocklistManager(sources []BlocklistSource, done chan struct{}) *blocklistManager {
+	bm := &blocklistManager{
+		merged:  &ipTrie{},
+		entries: make(map[string]blocklistEntry),
+	}
+
+	for _, src := range sources {
+		src := src
+		go func() {
+			bm.refresh(src)
+
+			ticker := time.NewTicker(src.RefreshInterval())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					bm.refresh(src)
+				}
+			}
+		}()
+	}
+
+	return bm
+}
+
+func (bm *blocklistManager) refresh(src BlocklistSource) {
+	bm.mu.RLock()
+	prevEntry, ok := bm.entries[src.Name()]
+	bm.mu.RUnlock()
+
+	var prevState *FetchState
+	if ok {
+		prevState = prevEntry.state
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cidrs, state, unchanged, err := src.Fetch(ctx, prevState)
+	if err != nil {
+		log.Printf("bbloker: blocklist %q fetch failed: %v", src.Name(), err)
+		bm.expireIfStale(src.Name())
+		return
+	}
+	if unchanged {
+		bm.renewTTL(src.Name(), src.TTL())
+		return
+	}
+
+	deduped := dedupeCIDRs(cidrs)
+	bm.mu.Lock()
+	bm.entries[src.Name()] = blocklistEntry{
+		cidrs:     deduped,
+		state:     state,
+		expiresAt: time.Now().Add(src.TTL()),
+	}
+	bm.rebuildLocked()
+	bm.mu.Unlock()
+}
+
+func (bm *blocklistManager) renewTTL(name string, ttl time.Duration) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	entry, ok := bm.entries[name]
+	if !ok {
+		return
+	}
+	entry.expiresAt = time.Now().Add(ttl)
+	bm.entries[name] = entry
+}
+
+func (bm *blocklistManager) expireIfStale(name string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	entry, ok := bm.entries[name]
+	if !ok || time.Now().Before(entry.expiresAt) {
+		return
+	}
+	delete(bm.entries, name)
+	bm.rebuildLocked()
+}
+
+// rebuildLocked recomputes the merged trie from all current entries. Caller
+// must hold bm.mu for writing.
+func (bm *blocklistManager) rebuildLocked() {
+	trie := &ipTrie{}
+	for name, entry := range bm.entries {
+		for _, cidr := range entry.cidrs {
+			if prefix, ok := parseCIDR(cidr); ok {
+				trie.insert(prefix, name)
+			}
+		}
+	}
+	bm.merged = trie
+}
+
+// lookup reports whether ip matches any source's blocks, and which source.
+func (bm *blocklistManager) lookup(ip string) (source string, ok bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	bm.mu.RLock()
+	trie := bm.merged
+	bm.mu.RUnlock()
+	if trie == nil {
+		return "", false
+	}
+	matched, src := trie.lookup(addr)
+	return src, matched
+}
+
+func dedupeCIDRs(cidrs []string) []string {
+	seen := make(map[string]struct{}, len(cidrs))
+	out := make([]string, 0, len(cidrs))
+	for _, c := range cidrs {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		out = append(out, c)
+	}
+	return out
+}
+
+// HTTPTextSource fetches a plain-text, newline-delimited CIDR list such as
+// FireHOL Level 1 or the Spamhaus DROP/EDROP lists. Text from the first "#"
+// or ";" on a line is a comment (Spamhaus puts "; SBL..." after each
+// entry), and blank lines are ignored.
+type HTTPTextSource struct {
+	SourceName string
+	URL        string
+	Interval   time.Duration
+	Expiry     time.Duration
+	Client     *http.Client
+}
+
+func (s *HTTPTextSource) Name() string                   { return s.SourceName }
+func (s *HTTPTextSource) RefreshInterval() time.Duration { return s.Interval }
+func (s *HTTPTextSource) TTL() time.Duration             { return s.Expiry }
+
+func (s *HTTPTextSource) Fetch(ctx context.Context, prev *FetchState) ([]string, *FetchState, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, prev, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, false, fmt.Errorf("bbloker: %s: unexpected status %d", s.SourceName, resp.StatusCode)
+	}
+
+	var cidrs []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		cidrs = append(cidrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, false, err
+	}
+
+	return cidrs, &FetchState{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, false, nil
+}
+
+// GeoIPSource fetches a MaxMind GeoLite2 CSV feed (country or ASN blocks)
+// and keeps only the rows whose geoname/AS identifier is in MatchIDs. The
+// CSV is expected in the GeoLite2 "Blocks" layout: the network is the first
+// column and the filtered identifier is at IDColumn.
+type GeoIPSource struct {
+	SourceName string
+	URL        string
+	Interval   time.Duration
+	Expiry     time.Duration
+	IDColumn   int
+	MatchIDs   map[string]struct{}
+	Client     *http.Client
+}
+
+func (s *GeoIPSource) Name() string                   { return s.SourceName }
+func (s *GeoIPSource) RefreshInterval() time.Duration { return s.Interval }
+func (s *GeoIPSource) TTL() time.Duration             { return s.Expiry }
+
+func (s *GeoIPSource) Fetch(ctx context.Context, prev *FetchState) ([]string, *FetchState, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if prev != nil && prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, prev, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, false, fmt.Errorf("bbloker: %s: unexpected status %d", s.SourceName, resp.StatusCode)
+	}
+
+	var cidrs []string
+	reader := bufio.NewReader(resp.Body)
+	header := true
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if header {
+				header = false
+			} else if cols := strings.Split(line, ","); len(cols) > s.IDColumn {
+				if _, want := s.MatchIDs[cols[s.IDColumn]]; want {
+					cidrs = append(cidrs, cols[0])
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, false, err
+		}
+	}
+
+	return cidrs, &FetchState{ETag: resp.Header.Get("ETag")}, false, nil
+}
+
+// JSONSource fetches a JSON feed such as CrowdSec CTI and extracts CIDRs
+// with Extract, which receives the raw response body.
+type JSONSource struct {
+	SourceName string
+	URL        string
+	Interval   time.Duration
+	Expiry     time.Duration
+	Headers    map[string]string
+	Extract    func(body []byte) ([]string, error)
+	Client     *http.Client
+}
+
+func (s *JSONSource) Name() string                   { return s.SourceName }
+func (s *JSONSource) RefreshInterval() time.Duration { return s.Interval }
+func (s *JSONSource) TTL() time.Duration             { return s.Expiry }
+
+func (s *JSONSource) Fetch(ctx context.Context, prev *FetchState) ([]string, *FetchState, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if prev != nil && prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, prev, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, false, fmt.Errorf("bbloker: %s: unexpected status %d", s.SourceName, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	cidrs, err := s.Extract(body)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return cidrs, &FetchState{ETag: resp.Header.Get("ETag")}, false, nil
+}
+
+// crowdSecCTIEntry is the shape of a single CrowdSec CTI decision; use it as
+// a reference Extract implementation for JSONSource.
+type crowdSecCTIEntry struct {
+	IPRange string `json:"ip_range"`
+	Value   string `json:"value"`
+}
+
+// ExtractCrowdSecCTI is a ready-made JSONSource.Extract for the CrowdSec CTI
+// decisions format: a JSON array of objects with an "ip_range" or "value"
+// field.
+func ExtractCrowdSecCTI(body []byte) ([]string, error) {
+	var entries []crowdSecCTIEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	cidrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IPRange != "" {
+			cidrs = append(cidrs, e.IPRange)
+		} else if e.Value != "" {
+			cidrs = append(cidrs, e.Value)
+		}
+	}
+	return cidrs, nil
+}
@@ -3,43 +3,107 @@ package bbloker
 import (
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Decision is the result of running a request through the detection pipeline.
 type Decision struct {
-	Action     string  // "block" or "allow"
-	Reason     string  // "known_bot_ua", "known_bot_ip", "rate_limit", "header_anomaly", or ""
+	Action string // "block" or "allow"
+
+	// Reason is one of "known_bot_ua", "known_bot_ip", "blocklist:<source>",
+	// "blocked_ja3", "blocked_h2_fingerprint", "rate_limit",
+	// "header_anomaly", or "" for an allowed request.
+	Reason string
+
 	Confidence float64 // 0.0–1.0
+
+	// RetryAfter is set on a "rate_limit" Decision to how long the caller
+	// should wait before retrying. It's populated by Config.RateLimiterBackend
+	// (or the default in-process limiter) and is zero for every other Reason.
+	RetryAfter time.Duration
 }
 
-// Analyze runs the 5-check detection pipeline against the given request.
+// Analyze runs the detection pipeline against the given request. It's
+// equivalent to AnalyzeTLS with a zero TLSFingerprint, so the JA3/H2
+// check never fires; use AnalyzeTLS (or HandlerWithTLS) to include it.
 func (b *Bbloker) Analyze(r *http.Request) Decision {
+	return b.AnalyzeTLS(r, TLSFingerprint{})
+}
+
+// AnalyzeTLS runs the detection pipeline against the given request, folding
+// in a TLSFingerprint captured via WrapTLSListener. A Config.BypassFunc match
+// allows the request immediately; otherwise each of the 7 checks runs
+// unless Config.RouteRules disables it (or overrides its threshold) for the
+// request's path. If set, Config.MetricsRegisterer collectors and
+// Config.EventSink both observe the resulting Decision.
+func (b *Bbloker) AnalyzeTLS(r *http.Request, tlsFP TLSFingerprint) (decision Decision) {
+	start := time.Now()
+	defer func() {
+		b.metrics.observeDecision(decision, time.Since(start))
+		if b.config.EventSink != nil {
+			b.config.EventSink(r.Context(), decision, r)
+		}
+	}()
+
+	if b.config.BypassFunc != nil && b.config.BypassFunc(r) {
+		return Decision{Action: "allow"}
+	}
+
+	policy, routeKey, _ := b.routes.resolve(r.URL.Path)
+
 	ip := extractIP(r)
 	ua := r.Header.Get("User-Agent")
 	headers := normalizeHeaders(r)
 
 	// 1. UA check
-	if b.rules.isBlockedUA(ua) {
+	if policy.runs("ua") && b.rules.isBlockedUA(ua) {
 		return Decision{Action: "block", Reason: "known_bot_ua", Confidence: 0.95}
 	}
 
-	// 2. IP check
-	if b.rules.isBlockedIP(ip) {
+	// 2. IP check (central bbloker API list)
+	if policy.runs("ip") && b.rules.isBlockedIP(ip) {
 		return Decision{Action: "block", Reason: "known_bot_ip", Confidence: 0.90}
 	}
 
-	// 3. Rate limit
-	if b.limiter.isExceeded(ip) {
-		return Decision{Action: "block", Reason: "rate_limit", Confidence: 0.70}
+	// 3. Pluggable blocklist sources (FireHOL, Spamhaus, GeoIP, CrowdSec, ...)
+	if policy.runs("blocklist") {
+		if source, ok := b.blocklists.lookup(ip); ok {
+			return Decision{Action: "block", Reason: "blocklist:" + source, Confidence: 0.90}
+		}
+	}
+
+	// 4. TLS/H2 fingerprint (JA3 hash and the Akamai-style H2 fingerprint;
+	// JA4 is not matched)
+	if policy.runs("tls_fingerprint") {
+		if b.rules.isBlockedJA3(tlsFP.JA3Hash) {
+			return Decision{Action: "block", Reason: "blocked_ja3", Confidence: 0.95}
+		}
+		if h2fp := tlsFP.h2Fingerprint(); b.rules.isBlockedH2Fingerprint(h2fp) {
+			return Decision{Action: "block", Reason: "blocked_h2_fingerprint", Confidence: 0.90}
+		}
+	}
+
+	// 5. Rate limit
+	if policy.runs("rate_limit") {
+		if allowed, retryAfter := b.checkRateLimit(r.Context(), ip, routeKey, policy.RateLimit); !allowed {
+			return Decision{Action: "block", Reason: "rate_limit", Confidence: 0.70, RetryAfter: retryAfter}
+		}
 	}
 
-	// 4. Header anomaly
-	score := b.rules.headerAnomalyScore(headers)
-	if score > b.rules.anomalyThreshold() {
-		return Decision{Action: "block", Reason: "header_anomaly", Confidence: score}
+	// 6. Header anomaly
+	if policy.runs("header_anomaly") {
+		threshold := b.rules.anomalyThreshold()
+		if policy.AnomalyThreshold != 0 {
+			threshold = policy.AnomalyThreshold
+		}
+		score := b.rules.headerAnomalyScore(headers)
+		b.metrics.observeHeaderAnomalyScore(score)
+		if score > threshold {
+			return Decision{Action: "block", Reason: "header_anomaly", Confidence: score}
+		}
 	}
 
-	// 5. Allow
+	// 7. Allow
 	return Decision{Action: "allow"}
 }
 
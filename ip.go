@@ -1,8 +1,8 @@
 package bbloker
 
 import (
-	"fmt"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
@@ -33,43 +33,15 @@ func stripPort(addr string) string {
 	return addr
 }
 
-// cidrContains checks if ip falls within the given CIDR block.
-// If cidr has no "/" it does an exact string match.
-func cidrContains(cidr, ip string) bool {
-	parts := strings.SplitN(cidr, "/", 2)
-	if len(parts) != 2 {
-		return cidr == ip
+// parseCIDR parses an IPv4 or IPv6 CIDR block (or a bare address, treated as
+// a /32 or /128) into a netip.Prefix. It returns false if s isn't a valid
+// address or CIDR block.
+func parseCIDR(s string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix, true
 	}
-
-	cidrIP := ipToUint32(parts[0])
-	targetIP := ipToUint32(ip)
-	if cidrIP == 0 || targetIP == 0 {
-		return false
-	}
-
-	var bits int
-	fmt.Sscanf(parts[1], "%d", &bits)
-	if bits < 0 || bits > 32 {
-		return false
-	}
-
-	mask := uint32(0xFFFFFFFF) << (32 - bits)
-	return (cidrIP & mask) == (targetIP & mask)
-}
-
-func ipToUint32(ip string) uint32 {
-	parts := strings.SplitN(ip, ".", 4)
-	if len(parts) != 4 {
-		return 0
-	}
-	var result uint32
-	for _, p := range parts {
-		var octet int
-		fmt.Sscanf(p, "%d", &octet)
-		if octet < 0 || octet > 255 {
-			return 0
-		}
-		result = result<<8 | uint32(octet)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
 	}
-	return result
+	return netip.Prefix{}, false
 }
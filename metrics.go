@@ -0,0 +1,105 @@
+package bbloker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsCollector holds the Prometheus collectors registered when
+// Config.MetricsRegisterer is set. A nil *metricsCollector is valid and
+// makes every method a no-op, so callers never need a nil check.
+type metricsCollector struct {
+	requestsTotal          *prometheus.CounterVec
+	analyzeDuration        prometheus.Histogram
+	headerAnomalyScore     prometheus.Histogram
+	ruleVersion            prometheus.Gauge
+	rateLimitWindowsActive prometheus.Gauge
+	telemetryBufferSize    prometheus.Gauge
+}
+
+func newMetricsCollector(reg prometheus.Registerer) *metricsCollector {
+	if reg == nil {
+		return nil
+	}
+
+	m := &metricsCollector{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "bbloker_requests_total",
+			Help: "Total requests run through Analyze, labeled by action and block reason.",
+		}, []string{"action", "reason"}),
+		analyzeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "bbloker_analyze_duration_seconds",
+			Help:    "Time spent running the Analyze detection pipeline.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		headerAnomalyScore: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "bbloker_header_anomaly_score",
+			Help:    "Computed header anomaly score, for requests that reached the header check.",
+			Buckets: prometheus.LinearBuckets(0, 0.1, 11),
+		}),
+		ruleVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bbloker_rule_version",
+			Help: "Version of the currently applied RuleSet.",
+		}),
+		rateLimitWindowsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bbloker_rate_limit_windows_active",
+			Help: "Number of IPs with a currently active rate-limit window.",
+		}),
+		telemetryBufferSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bbloker_telemetry_buffer_size",
+			Help: "Number of fingerprints currently buffered for the next telemetry flush.",
+		}),
+	}
+
+	reg.MustRegister(
+		m.requestsTotal,
+		m.analyzeDuration,
+		m.headerAnomalyScore,
+		m.ruleVersion,
+		m.rateLimitWindowsActive,
+		m.telemetryBufferSize,
+	)
+
+	return m
+}
+
+func (m *metricsCollector) observeDecision(d Decision, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	reason := d.Reason
+	if reason == "" {
+		reason = "none"
+	}
+	m.requestsTotal.WithLabelValues(d.Action, reason).Inc()
+	m.analyzeDuration.Observe(duration.Seconds())
+}
+
+func (m *metricsCollector) observeHeaderAnomalyScore(score float64) {
+	if m == nil {
+		return
+	}
+	m.headerAnomalyScore.Observe(score)
+}
+
+func (m *metricsCollector) setRuleVersion(version uint64) {
+	if m == nil {
+		return
+	}
+	m.ruleVersion.Set(float64(version))
+}
+
+func (m *metricsCollector) setRateLimitWindowsActive(n int) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWindowsActive.Set(float64(n))
+}
+
+func (m *metricsCollector) setTelemetryBufferSize(n int) {
+	if m == nil {
+		return
+	}
+	m.telemetryBufferSize.Set(float64(n))
+}
@@ -9,18 +9,41 @@ func (b *Bbloker) Handler(next http.Handler) http.Handler {
 		decision := b.Analyze(r)
 
 		// Report telemetry (non-blocking).
-		fp := buildFingerprint(r)
+		fp := buildFingerprint(r, TLSFingerprint{})
 		go b.telemetry.push(fp)
 
-		if decision.Action == "block" {
-			if b.config.OnBlock != nil {
-				b.config.OnBlock(w, r, decision)
-				return
-			}
-			w.WriteHeader(http.StatusForbidden)
+		b.serveDecision(w, r, next, decision)
+	})
+}
+
+// HandlerWithTLS is like Handler, but additionally folds the connection's
+// TLS ClientHello (JA3/JA4) and HTTP/2 preface (Akamai-style SETTINGS/
+// WINDOW_UPDATE) fingerprint into the decision. It requires the server to
+// be serving through a listener from WrapTLSListener with ConnContext set
+// as http.Server.ConnContext; without that, the fingerprint is simply empty
+// and this behaves exactly like Handler.
+func (b *Bbloker) HandlerWithTLS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tlsFP, _ := FingerprintFromContext(r.Context())
+		decision := b.AnalyzeTLS(r, tlsFP)
+
+		// Report telemetry (non-blocking).
+		fp := buildFingerprint(r, tlsFP)
+		go b.telemetry.push(fp)
+
+		b.serveDecision(w, r, next, decision)
+	})
+}
+
+func (b *Bbloker) serveDecision(w http.ResponseWriter, r *http.Request, next http.Handler, decision Decision) {
+	if decision.Action == "block" {
+		if b.config.OnBlock != nil {
+			b.config.OnBlock(w, r, decision)
 			return
 		}
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	next.ServeHTTP(w, r)
 }
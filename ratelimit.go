@@ -1,10 +1,53 @@
 package bbloker
 
 import (
+	"context"
+	"log"
 	"sync"
 	"time"
 )
 
+// checkRateLimit reports whether ip may proceed. If Config.RateLimiterBackend
+// is set, it's consulted directly (route-specific overrides don't apply,
+// since a shared distributed bucket doesn't have a notion of "this process's
+// window"); otherwise the default in-process limiter runs, honoring
+// routeOverride from RoutePolicy.RateLimit and keying the window by routeKey
+// (the matched RouteRules pattern, or "" outside any route) so routes with
+// different overrides don't share a budget.
+func (b *Bbloker) checkRateLimit(ctx context.Context, ip, routeKey string, routeOverride int) (allowed bool, retryAfter time.Duration) {
+	if b.config.RateLimiterBackend != nil {
+		allowed, retryAfter, err := b.config.RateLimiterBackend.Allow(ctx, ip)
+		if err != nil {
+			log.Printf("bbloker: rate limiter backend error, allowing request: %v", err)
+			return true, 0
+		}
+		return allowed, retryAfter
+	}
+
+	key := windowKey(routeKey, ip)
+	if b.limiter.isExceeded(key, routeOverride) {
+		return false, b.limiter.retryAfter(key)
+	}
+	return true, 0
+}
+
+// windowKey derives a rateLimiter window key that keeps a route's overridden
+// budget independent of the global (or any other route's) budget for the
+// same ip.
+func windowKey(routeKey, ip string) string {
+	return routeKey + "|" + ip
+}
+
+// RateLimiterBackend decides whether a request from ip may proceed. The
+// default is an in-process fixed-window counter (see rateLimiter); Redis
+// backends (see RedisRateLimiterBackend) make the limit consistent across
+// replicas instead of counting independently per process.
+type RateLimiterBackend interface {
+	// Allow reports whether ip may proceed. If not, retryAfter is how long
+	// the caller should wait before trying again.
+	Allow(ctx context.Context, ip string) (allowed bool, retryAfter time.Duration, err error)
+}
+
 type window struct {
 	count   int
 	resetAt int64 // unix milliseconds
@@ -15,16 +58,34 @@ type rateLimiter struct {
 	windows     map[string]*window
 	maxRequests int
 	windowMs    int64
+	store       Store
+	metrics     *metricsCollector
 }
 
-func newRateLimiter(maxRequests int, windowDur time.Duration, done chan struct{}) *rateLimiter {
+func newRateLimiter(maxRequests int, windowDur time.Duration, done chan struct{}, store Store, metrics *metricsCollector) *rateLimiter {
 	rl := &rateLimiter{
 		windows:     make(map[string]*window),
 		maxRequests: maxRequests,
 		windowMs:    windowDur.Milliseconds(),
+		store:       store,
+		metrics:     metrics,
+	}
+
+	if store != nil {
+		if persisted, err := store.LoadRateLimitWindows(); err != nil {
+			log.Printf("bbloker: loading persisted rate limit windows: %v", err)
+		} else {
+			now := time.Now().UnixMilli()
+			for key, rec := range persisted {
+				if rec.ResetAt > now {
+					rl.windows[key] = &window{count: rec.Count, resetAt: rec.ResetAt}
+				}
+			}
+		}
 	}
 
-	// Cleanup goroutine removes expired windows every 60s.
+	// Cleanup goroutine removes expired windows and snapshots the rest to
+	// the store (if any) every 60s.
 	go func() {
 		ticker := time.NewTicker(60 * time.Second)
 		defer ticker.Stop()
@@ -34,6 +95,7 @@ func newRateLimiter(maxRequests int, windowDur time.Duration, done chan struct{}
 				return
 			case <-ticker.C:
 				rl.cleanup()
+				rl.persist()
 			}
 		}
 	}()
@@ -41,28 +103,87 @@ func newRateLimiter(maxRequests int, windowDur time.Duration, done chan struct{}
 	return rl
 }
 
-func (rl *rateLimiter) isExceeded(ip string) bool {
+// isExceeded reports whether key has exceeded its requests-per-window
+// budget. key identifies the window — windowKey(routeKey, ip) for the
+// default in-process backend, or a bare ip when rateLimiter is used
+// directly as a RateLimiterBackend. maxOverride, if non-zero, replaces the
+// configured maxRequests — used by RoutePolicy.RateLimit to apply a
+// tighter or looser limit on specific routes, each with its own window
+// since routeKey is baked into the key.
+func (rl *rateLimiter) isExceeded(key string, maxOverride int) bool {
+	max := rl.maxRequests
+	if maxOverride != 0 {
+		max = maxOverride
+	}
+
 	now := time.Now().UnixMilli()
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	w, ok := rl.windows[ip]
+	w, ok := rl.windows[key]
 	if !ok || now >= w.resetAt {
-		rl.windows[ip] = &window{count: 1, resetAt: now + rl.windowMs}
+		rl.windows[key] = &window{count: 1, resetAt: now + rl.windowMs}
 		return false
 	}
 
 	w.count++
-	return w.count > rl.maxRequests
+	return w.count > max
+}
+
+// Allow implements RateLimiterBackend using the fixed-window counter, so
+// rateLimiter itself can serve as the default backend. The context is
+// unused — the in-process counter never blocks on I/O.
+func (rl *rateLimiter) Allow(_ context.Context, ip string) (bool, time.Duration, error) {
+	if !rl.isExceeded(ip, 0) {
+		return true, 0, nil
+	}
+	return false, rl.retryAfter(ip), nil
+}
+
+// retryAfter reports how long key should wait before its window resets.
+func (rl *rateLimiter) retryAfter(key string) time.Duration {
+	rl.mu.Lock()
+	w := rl.windows[key]
+	rl.mu.Unlock()
+
+	if w == nil {
+		return 0
+	}
+	if d := time.Until(time.UnixMilli(w.resetAt)); d > 0 {
+		return d
+	}
+	return 0
 }
 
 func (rl *rateLimiter) cleanup() {
 	now := time.Now().UnixMilli()
 	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	for ip, w := range rl.windows {
+	for key, w := range rl.windows {
 		if now >= w.resetAt {
-			delete(rl.windows, ip)
+			delete(rl.windows, key)
 		}
 	}
+	active := len(rl.windows)
+	rl.mu.Unlock()
+
+	rl.metrics.setRateLimitWindowsActive(active)
+}
+
+// persist snapshots all active windows to the store so a restart doesn't
+// reset abusers' counters. A no-op when no store is configured.
+func (rl *rateLimiter) persist() {
+	if rl.store == nil {
+		return
+	}
+
+	rl.mu.Lock()
+	snapshot := make(map[string]RateLimitRecord, len(rl.windows))
+	for key, w := range rl.windows {
+		snapshot[key] = RateLimitRecord{Count: w.count, ResetAt: w.resetAt}
+	}
+	rl.mu.Unlock()
+
+	if err := rl.store.SaveRateLimitWindows(snapshot); err != nil {
+		log.Printf("bbloker: persisting rate limit windows: %v", err)
+	}
 }
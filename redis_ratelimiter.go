@@ -0,0 +1,96 @@
+package bbloker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript atomically refills and spends one token from the
+// hash at KEYS[1], keyed by IP. ARGV: burst capacity, refill rate (tokens
+// per second), current unix time (float seconds), and the key's TTL in
+// seconds (so idle IPs don't accumulate hash entries forever).
+//
+// It returns {allowed (0/1), retry_after_seconds}.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local data = redis.call("HMGET", key, "tokens", "last")
+local tokens = tonumber(data[1])
+local last = tonumber(data[2])
+if tokens == nil then
+	tokens = burst
+	last = now
+end
+
+local elapsed = math.max(0, now - last)
+tokens = math.min(burst, tokens + elapsed * rate)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_after = (1 - tokens) / rate
+end
+
+redis.call("HMSET", key, "tokens", tokens, "last", now)
+redis.call("EXPIRE", key, ttl)
+
+return {allowed, tostring(retry_after)}
+`)
+
+// RedisRateLimiterBackend is a RateLimiterBackend that shares a token
+// bucket per IP across replicas via Redis, using tokenBucketScript so the
+// read-refill-spend-write sequence is atomic.
+type RedisRateLimiterBackend struct {
+	client    redis.UniversalClient
+	burst     int
+	rate      float64 // tokens per second
+	keyPrefix string
+	ttl       time.Duration
+}
+
+// NewRedisRateLimiterBackend returns a RedisRateLimiterBackend. burst is
+// the bucket capacity and rate is the refill rate in tokens per second;
+// assign the result to Config.RateLimiterBackend.
+func NewRedisRateLimiterBackend(client redis.UniversalClient, burst int, rate float64) *RedisRateLimiterBackend {
+	return &RedisRateLimiterBackend{
+		client:    client,
+		burst:     burst,
+		rate:      rate,
+		keyPrefix: "bbloker:ratelimit:",
+		ttl:       10 * time.Minute,
+	}
+}
+
+func (b *RedisRateLimiterBackend) Allow(ctx context.Context, ip string) (bool, time.Duration, error) {
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+
+	res, err := tokenBucketScript.Run(ctx, b.client,
+		[]string{b.keyPrefix + ip},
+		b.burst, b.rate, now, int(b.ttl.Seconds()),
+	).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, nil
+	}
+
+	allowed, _ := res[0].(int64)
+	retrySeconds, _ := res[1].(string)
+	var retryAfter time.Duration
+	if secs, err := strconv.ParseFloat(retrySeconds, 64); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs * float64(time.Second))
+	}
+
+	return allowed == 1, retryAfter, nil
+}
@@ -0,0 +1,87 @@
+package bbloker
+
+import (
+	"regexp"
+	"sort"
+)
+
+// RoutePolicy overrides pipeline behavior for requests whose path matches
+// the RoutePolicy's pattern in Config.RouteRules. Zero values mean "use the
+// global Config setting".
+type RoutePolicy struct {
+	// AnomalyThreshold overrides the RuleSet's AnomalyThreshold.
+	AnomalyThreshold float64
+
+	// RateLimit overrides Config.RateLimit (max requests per IP per
+	// window).
+	RateLimit int
+
+	// Checks restricts which checks run for this route. Valid values:
+	// "ua", "ip", "blocklist", "tls_fingerprint", "rate_limit",
+	// "header_anomaly". A nil slice means all checks run, same as the
+	// default pipeline.
+	Checks []string
+}
+
+func (p RoutePolicy) runs(check string) bool {
+	if p.Checks == nil {
+		return true
+	}
+	for _, c := range p.Checks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
+
+// routeRule is a compiled Config.RouteRules entry.
+type routeRule struct {
+	pattern string
+	re      *regexp.Regexp
+	policy  RoutePolicy
+}
+
+// routeTable resolves a request path to its RoutePolicy.
+type routeTable struct {
+	rules []routeRule
+}
+
+// newRouteTable compiles Config.RouteRules. Keys are regular expressions
+// matched against r.URL.Path — use an anchored literal like "^/api/" for
+// plain prefix matching. Invalid patterns are skipped. Rules are evaluated
+// in a fixed, sorted order so overlapping patterns resolve deterministically
+// (first match wins); put more specific patterns earlier if needed by
+// relying on lexical order, or avoid overlap entirely.
+func newRouteTable(rules map[string]RoutePolicy) *routeTable {
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	rt := &routeTable{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		rt.rules = append(rt.rules, routeRule{pattern: pattern, re: re, policy: rules[pattern]})
+	}
+	return rt
+}
+
+// resolve returns the policy for the first rule matching path, that rule's
+// pattern (the route key, used to key per-route state like rate-limit
+// windows independently of other routes), and whether any rule matched.
+func (rt *routeTable) resolve(path string) (policy RoutePolicy, routeKey string, matched bool) {
+	if rt == nil {
+		return RoutePolicy{}, "", false
+	}
+	for _, rule := range rt.rules {
+		if rule.re.MatchString(path) {
+			return rule.policy, rule.pattern, true
+		}
+	}
+	return RoutePolicy{}, "", false
+}
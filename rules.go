@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/netip"
 	"regexp"
 	"strings"
 	"sync"
@@ -20,12 +21,14 @@ type HeaderPattern struct {
 // RuleSet is the full set of detection rules, fetched from the API or
 // falling back to hardcoded defaults.
 type RuleSet struct {
-	Version          uint64          `json:"version"`
-	UpdatedAt        string          `json:"updatedAt"`
-	BlockedUAs       []string        `json:"blockedUAs"`
-	BlockedIPs       []string        `json:"blockedIPs"`
-	HeaderPatterns   []HeaderPattern `json:"headerPatterns"`
-	AnomalyThreshold float64        `json:"anomalyThreshold"`
+	Version               uint64          `json:"version"`
+	UpdatedAt             string          `json:"updatedAt"`
+	BlockedUAs            []string        `json:"blockedUAs"`
+	BlockedIPs            []string        `json:"blockedIPs"`
+	HeaderPatterns        []HeaderPattern `json:"headerPatterns"`
+	AnomalyThreshold      float64         `json:"anomalyThreshold"`
+	BlockedJA3Hashes      []string        `json:"blockedJA3Hashes"`
+	BlockedH2Fingerprints []string        `json:"blockedH2Fingerprints"`
 }
 
 var defaultRules = RuleSet{
@@ -88,17 +91,36 @@ type ruleManager struct {
 	uaLower []string
 	// Compiled header-anomaly regexes, parallel to current.HeaderPatterns.
 	headerRe []*regexp.Regexp
+	// ipBlocks indexes current.BlockedIPs for O(prefix length) lookups.
+	ipBlocks *ipTrie
+	// ja3Blocked and h2Blocked index current.BlockedJA3Hashes and
+	// current.BlockedH2Fingerprints for O(1) lookups.
+	ja3Blocked map[string]struct{}
+	h2Blocked  map[string]struct{}
 
-	apiURL string
-	apiKey string
+	apiURL  string
+	apiKey  string
+	store   Store
+	metrics *metricsCollector
 }
 
-func newRuleManager(apiURL, apiKey string, interval time.Duration, done chan struct{}) *ruleManager {
+func newRuleManager(apiURL, apiKey string, interval time.Duration, done chan struct{}, store Store, metrics *metricsCollector) *ruleManager {
 	rm := &ruleManager{
-		apiURL: apiURL,
-		apiKey: apiKey,
+		apiURL:  apiURL,
+		apiKey:  apiKey,
+		store:   store,
+		metrics: metrics,
 	}
-	rm.applyRules(defaultRules)
+
+	initial := defaultRules
+	if store != nil {
+		if rs, ok, err := store.LoadRuleSet(); err != nil {
+			log.Printf("bbloker: loading persisted rule set: %v", err)
+		} else if ok {
+			initial = rs
+		}
+	}
+	rm.applyRules(initial)
 
 	// Kick off first sync immediately, then on ticker.
 	go func() {
@@ -134,11 +156,33 @@ func (rm *ruleManager) applyRules(rs RuleSet) {
 		compiled[i] = re
 	}
 
+	blocks := &ipTrie{}
+	for _, cidr := range rs.BlockedIPs {
+		if prefix, ok := parseCIDR(cidr); ok {
+			blocks.insert(prefix, "")
+		}
+	}
+
+	ja3Blocked := make(map[string]struct{}, len(rs.BlockedJA3Hashes))
+	for _, hash := range rs.BlockedJA3Hashes {
+		ja3Blocked[strings.ToLower(hash)] = struct{}{}
+	}
+
+	h2Blocked := make(map[string]struct{}, len(rs.BlockedH2Fingerprints))
+	for _, fp := range rs.BlockedH2Fingerprints {
+		h2Blocked[fp] = struct{}{}
+	}
+
 	rm.mu.Lock()
 	rm.current = rs
 	rm.uaLower = lower
 	rm.headerRe = compiled
+	rm.ipBlocks = blocks
+	rm.ja3Blocked = ja3Blocked
+	rm.h2Blocked = h2Blocked
 	rm.mu.Unlock()
+
+	rm.metrics.setRuleVersion(rs.Version)
 }
 
 func (rm *ruleManager) syncOnce() {
@@ -169,6 +213,11 @@ func (rm *ruleManager) syncOnce() {
 	if rs.Version > currentVersion {
 		log.Printf("bbloker: rules updated v%d → v%d", currentVersion, rs.Version)
 		rm.applyRules(rs)
+		if rm.store != nil {
+			if err := rm.store.SaveRuleSet(rs); err != nil {
+				log.Printf("bbloker: persisting rule set: %v", err)
+			}
+		}
 	}
 }
 
@@ -185,16 +234,44 @@ func (rm *ruleManager) isBlockedUA(ua string) bool {
 	return false
 }
 
-// isBlockedIP checks whether ip falls within any blocked CIDR range.
+// isBlockedIP checks whether ip falls within any blocked CIDR range. It
+// supports both IPv4 and IPv6; unparseable addresses never match.
 func (rm *ruleManager) isBlockedIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
-	for _, cidr := range rm.current.BlockedIPs {
-		if cidrContains(cidr, ip) {
-			return true
-		}
+	if rm.ipBlocks == nil {
+		return false
 	}
-	return false
+	matched, _ := rm.ipBlocks.lookup(addr)
+	return matched
+}
+
+// isBlockedJA3 checks ja3Hash (the MD5 hex digest, as in TLSFingerprint.JA3Hash)
+// against RuleSet.BlockedJA3Hashes.
+func (rm *ruleManager) isBlockedJA3(ja3Hash string) bool {
+	if ja3Hash == "" {
+		return false
+	}
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	_, blocked := rm.ja3Blocked[strings.ToLower(ja3Hash)]
+	return blocked
+}
+
+// isBlockedH2Fingerprint checks an Akamai-style HTTP/2 fingerprint string
+// against RuleSet.BlockedH2Fingerprints.
+func (rm *ruleManager) isBlockedH2Fingerprint(fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	_, blocked := rm.h2Blocked[fingerprint]
+	return blocked
 }
 
 // headerAnomalyScore sums the weights of header patterns whose regex matches.
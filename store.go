@@ -0,0 +1,54 @@
+package bbloker
+
+// RateLimitRecord is a snapshot of one IP's rate-limit window, as persisted
+// by a Store so a restart doesn't reset abusers' counters.
+type RateLimitRecord struct {
+	Count   int
+	ResetAt int64 // unix milliseconds
+}
+
+// TelemetryQueueItem is a fingerprint batch that failed to flush to the
+// central API, held by a Store for retry with backoff.
+type TelemetryQueueItem struct {
+	ID          int64
+	Payload     []byte
+	Attempts    int
+	NextRetryAt int64 // unix milliseconds
+}
+
+// Store persists state that would otherwise be lost on restart: the
+// last-synced RuleSet (so offline restarts don't fall back to hardcoded
+// defaults), rate-limiter windows (so abusers don't get a fresh budget on
+// every deploy), and telemetry events that failed to flush.
+//
+// Implementations must be safe for concurrent use. SQLiteStore and
+// BoltStore are provided; a nil Store disables persistence entirely and
+// every component behaves as it did before Store existed.
+type Store interface {
+	// SaveRuleSet persists the most recently applied RuleSet.
+	SaveRuleSet(rs RuleSet) error
+	// LoadRuleSet returns the last persisted RuleSet. ok is false if none
+	// has ever been saved.
+	LoadRuleSet() (rs RuleSet, ok bool, err error)
+
+	// SaveRateLimitWindows overwrites the persisted rate-limit snapshot.
+	SaveRateLimitWindows(windows map[string]RateLimitRecord) error
+	// LoadRateLimitWindows returns the last persisted rate-limit snapshot.
+	LoadRateLimitWindows() (map[string]RateLimitRecord, error)
+
+	// EnqueueTelemetry adds a failed flush's JSON-encoded payload to the
+	// retry queue.
+	EnqueueTelemetry(payload []byte) error
+	// PendingTelemetry returns queued items whose NextRetryAt has elapsed,
+	// oldest first.
+	PendingTelemetry(nowMs int64) ([]TelemetryQueueItem, error)
+	// AckTelemetry removes an item from the retry queue after a
+	// successful resend.
+	AckTelemetry(id int64) error
+	// BumpTelemetryRetry records a failed retry attempt and schedules the
+	// next one.
+	BumpTelemetryRetry(id int64, nextRetryAtMs int64) error
+
+	// Close releases any underlying file handles or connections.
+	Close() error
+}
@@ -0,0 +1,178 @@
+package bbloker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltBucketRuleSet        = []byte("rule_set")
+	boltBucketRateLimit      = []byte("rate_limit_window")
+	boltBucketTelemetryQueue = []byte("telemetry_queue")
+	boltRuleSetKey           = []byte("current")
+)
+
+// BoltStore is a Store backed by a local BoltDB (bbolt) file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path and
+// ensures its buckets exist.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltBucketRuleSet, boltBucketRateLimit, boltBucketTelemetryQueue} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) SaveRuleSet(rs RuleSet) error {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketRuleSet).Put(boltRuleSetKey, data)
+	})
+}
+
+func (s *BoltStore) LoadRuleSet() (RuleSet, bool, error) {
+	var rs RuleSet
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltBucketRuleSet).Get(boltRuleSetKey)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &rs)
+	})
+	if err != nil {
+		return RuleSet{}, false, err
+	}
+	return rs, found, nil
+}
+
+func (s *BoltStore) SaveRateLimitWindows(windows map[string]RateLimitRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucketRateLimit)
+		if err := b.ForEach(func(k, v []byte) error {
+			return b.Delete(k)
+		}); err != nil {
+			return err
+		}
+		for ip, rec := range windows {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(ip), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) LoadRateLimitWindows() (map[string]RateLimitRecord, error) {
+	windows := make(map[string]RateLimitRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketRateLimit).ForEach(func(k, v []byte) error {
+			var rec RateLimitRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			windows[string(k)] = rec
+			return nil
+		})
+	})
+	return windows, err
+}
+
+func (s *BoltStore) EnqueueTelemetry(payload []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucketTelemetryQueue)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		item := TelemetryQueueItem{ID: int64(id), Payload: payload}
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), data)
+	})
+}
+
+func (s *BoltStore) PendingTelemetry(nowMs int64) ([]TelemetryQueueItem, error) {
+	var items []TelemetryQueueItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketTelemetryQueue).ForEach(func(k, v []byte) error {
+			var item TelemetryQueueItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if item.NextRetryAt <= nowMs {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (s *BoltStore) AckTelemetry(id int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketTelemetryQueue).Delete(itob(uint64(id)))
+	})
+}
+
+func (s *BoltStore) BumpTelemetryRetry(id int64, nextRetryAtMs int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucketTelemetryQueue)
+		key := itob(uint64(id))
+		data := b.Get(key)
+		if data == nil {
+			return nil
+		}
+		var item TelemetryQueueItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		item.Attempts++
+		item.NextRetryAt = nextRetryAtMs
+		updated, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, updated)
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
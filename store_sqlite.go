@@ -0,0 +1,176 @@
+package bbloker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is a Store backed by a local SQLite file, in the spirit of
+// the traffic.db persistence used by forgejo-crawler-blocker-style tools.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) a SQLite database at path
+// and ensures its schema exists.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1) // sqlite allows one writer at a time
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) migrate() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS rule_set (
+			id    INTEGER PRIMARY KEY CHECK (id = 1),
+			data  TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS rate_limit_window (
+			ip       TEXT PRIMARY KEY,
+			count    INTEGER NOT NULL,
+			reset_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS telemetry_queue (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			payload        BLOB NOT NULL,
+			attempts       INTEGER NOT NULL DEFAULT 0,
+			next_retry_at  INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func (s *SQLiteStore) SaveRuleSet(rs RuleSet) error {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO rule_set (id, data) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET data = excluded.data
+	`, string(data))
+	return err
+}
+
+func (s *SQLiteStore) LoadRuleSet() (RuleSet, bool, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM rule_set WHERE id = 1`).Scan(&data)
+	if err == sql.ErrNoRows {
+		return RuleSet{}, false, nil
+	}
+	if err != nil {
+		return RuleSet{}, false, err
+	}
+	var rs RuleSet
+	if err := json.Unmarshal([]byte(data), &rs); err != nil {
+		return RuleSet{}, false, err
+	}
+	return rs, true, nil
+}
+
+func (s *SQLiteStore) SaveRateLimitWindows(windows map[string]RateLimitRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM rate_limit_window`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO rate_limit_window (ip, count, reset_at) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for ip, rec := range windows {
+		if _, err := stmt.Exec(ip, rec.Count, rec.ResetAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) LoadRateLimitWindows() (map[string]RateLimitRecord, error) {
+	rows, err := s.db.Query(`SELECT ip, count, reset_at FROM rate_limit_window`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make(map[string]RateLimitRecord)
+	for rows.Next() {
+		var ip string
+		var rec RateLimitRecord
+		if err := rows.Scan(&ip, &rec.Count, &rec.ResetAt); err != nil {
+			return nil, err
+		}
+		windows[ip] = rec
+	}
+	return windows, rows.Err()
+}
+
+func (s *SQLiteStore) EnqueueTelemetry(payload []byte) error {
+	_, err := s.db.Exec(`INSERT INTO telemetry_queue (payload) VALUES (?)`, payload)
+	return err
+}
+
+func (s *SQLiteStore) PendingTelemetry(nowMs int64) ([]TelemetryQueueItem, error) {
+	rows, err := s.db.Query(`
+		SELECT id, payload, attempts, next_retry_at FROM telemetry_queue
+		WHERE next_retry_at <= ? ORDER BY id ASC
+	`, nowMs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TelemetryQueueItem
+	for rows.Next() {
+		var it TelemetryQueueItem
+		if err := rows.Scan(&it.ID, &it.Payload, &it.Attempts, &it.NextRetryAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLiteStore) AckTelemetry(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM telemetry_queue WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) BumpTelemetryRetry(id int64, nextRetryAtMs int64) error {
+	res, err := s.db.Exec(`
+		UPDATE telemetry_queue SET attempts = attempts + 1, next_retry_at = ?
+		WHERE id = ?
+	`, nextRetryAtMs, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("bbloker: telemetry queue item %d not found", id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
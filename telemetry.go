@@ -3,6 +3,8 @@ package bbloker
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"sort"
 	"strings"
@@ -10,6 +12,22 @@ import (
 	"time"
 )
 
+// telemetryMaxRetries caps how many times a failed batch is retried before
+// it's dropped for good; telemetryRetryBackoff computes the delay before
+// attempt n.
+const telemetryMaxRetries = 8
+
+func telemetryRetryBackoff(attempt int) time.Duration {
+	d := 5 * time.Second
+	for i := 0; i < attempt; i++ {
+		d *= 2
+		if d > 10*time.Minute {
+			return 10 * time.Minute
+		}
+	}
+	return d
+}
+
 type fingerprint struct {
 	IP          string            `json:"ip"`
 	UserAgent   string            `json:"userAgent"`
@@ -18,6 +36,15 @@ type fingerprint struct {
 	Path        string            `json:"path"`
 	Method      string            `json:"method"`
 	Ts          float64           `json:"ts"`
+
+	// JA3/JA4/H2 fields are populated only when the request was served
+	// through Bbloker.HandlerWithTLS over a listener wrapped with
+	// WrapTLSListener; otherwise they're left zero.
+	JA3             string   `json:"ja3,omitempty"`
+	JA3Hash         string   `json:"ja3Hash,omitempty"`
+	JA4             string   `json:"ja4,omitempty"`
+	H2SettingsOrder []uint16 `json:"h2SettingsOrder,omitempty"`
+	H2WindowUpdate  uint32   `json:"h2WindowUpdate,omitempty"`
 }
 
 type telemetryPayload struct {
@@ -31,14 +58,18 @@ type telemetryClient struct {
 	apiKey    string
 	maxBuffer int
 	enabled   bool
+	store     Store
+	metrics   *metricsCollector
 }
 
-func newTelemetryClient(apiURL, apiKey string, maxBuffer int, enabled bool, interval time.Duration, done chan struct{}) *telemetryClient {
+func newTelemetryClient(apiURL, apiKey string, maxBuffer int, enabled bool, interval time.Duration, done chan struct{}, store Store, metrics *metricsCollector) *telemetryClient {
 	tc := &telemetryClient{
 		apiURL:    apiURL,
 		apiKey:    apiKey,
 		maxBuffer: maxBuffer,
 		enabled:   enabled,
+		store:     store,
+		metrics:   metrics,
 	}
 
 	if !enabled {
@@ -58,6 +89,21 @@ func newTelemetryClient(apiURL, apiKey string, maxBuffer int, enabled bool, inte
 		}
 	}()
 
+	if store != nil {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					tc.drainRetryQueue()
+				}
+			}
+		}()
+	}
+
 	return tc
 }
 
@@ -68,8 +114,10 @@ func (tc *telemetryClient) push(fp fingerprint) {
 	tc.mu.Lock()
 	tc.buffer = append(tc.buffer, fp)
 	shouldFlush := len(tc.buffer) >= tc.maxBuffer
+	bufferSize := len(tc.buffer)
 	tc.mu.Unlock()
 
+	tc.metrics.setTelemetryBufferSize(bufferSize)
 	if shouldFlush {
 		go tc.flush()
 	}
@@ -84,28 +132,88 @@ func (tc *telemetryClient) flush() {
 	batch := tc.buffer
 	tc.buffer = nil
 	tc.mu.Unlock()
+	tc.metrics.setTelemetryBufferSize(0)
 
 	body, err := json.Marshal(telemetryPayload{Events: batch})
 	if err != nil {
 		return
 	}
 
+	if err := tc.send(body); err != nil {
+		if tc.store == nil {
+			log.Printf("bbloker: telemetry flush failed, dropping batch: %v", err)
+			return
+		}
+		log.Printf("bbloker: telemetry flush failed, queuing for retry: %v", err)
+		tc.enqueueRetry(body)
+	}
+}
+
+func (tc *telemetryClient) send(body []byte) error {
 	req, err := http.NewRequest("POST", tc.apiURL+"/v1/fingerprints", bytes.NewReader(body))
 	if err != nil {
-		return
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+tc.apiKey)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("bbloker: telemetry endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// enqueueRetry hands a batch that failed to flush off to the store's
+// retry queue, so a transient upstream outage doesn't lose events. The
+// queue has no size limit; drainRetryQueue removes a batch only once it is
+// delivered or has failed telemetryMaxRetries resends.
+func (tc *telemetryClient) enqueueRetry(body []byte) {
+	if tc.store == nil {
+		return
+	}
+	if err := tc.store.EnqueueTelemetry(body); err != nil {
+		log.Printf("bbloker: enqueueing telemetry retry: %v", err)
+	}
+}
+
+// drainRetryQueue resends queued batches whose backoff has elapsed,
+// dropping any that have exceeded telemetryMaxRetries.
+func (tc *telemetryClient) drainRetryQueue() {
+	items, err := tc.store.PendingTelemetry(time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("bbloker: reading telemetry retry queue: %v", err)
 		return
 	}
-	resp.Body.Close()
+
+	for _, item := range items {
+		if err := tc.send(item.Payload); err != nil {
+			if item.Attempts+1 >= telemetryMaxRetries {
+				log.Printf("bbloker: dropping telemetry batch %d after %d attempts: %v", item.ID, item.Attempts+1, err)
+				if ackErr := tc.store.AckTelemetry(item.ID); ackErr != nil {
+					log.Printf("bbloker: dropping telemetry batch %d: %v", item.ID, ackErr)
+				}
+				continue
+			}
+			nextRetryAt := time.Now().Add(telemetryRetryBackoff(item.Attempts)).UnixMilli()
+			if bumpErr := tc.store.BumpTelemetryRetry(item.ID, nextRetryAt); bumpErr != nil {
+				log.Printf("bbloker: scheduling telemetry retry for batch %d: %v", item.ID, bumpErr)
+			}
+			continue
+		}
+		if err := tc.store.AckTelemetry(item.ID); err != nil {
+			log.Printf("bbloker: acking telemetry batch %d: %v", item.ID, err)
+		}
+	}
 }
 
-// buildFingerprint creates a fingerprint from an HTTP request.
-func buildFingerprint(r *http.Request) fingerprint {
+// buildFingerprint creates a fingerprint from an HTTP request, optionally
+// folding in TLS/H2-level data captured via WrapTLSListener.
+func buildFingerprint(r *http.Request, tlsFP TLSFingerprint) fingerprint {
 	headers := make(map[string]string, len(r.Header))
 	order := make([]string, 0, len(r.Header))
 	for k, v := range r.Header {
@@ -116,12 +224,17 @@ func buildFingerprint(r *http.Request) fingerprint {
 	sort.Strings(order)
 
 	return fingerprint{
-		IP:          extractIP(r),
-		UserAgent:   r.Header.Get("User-Agent"),
-		HeaderOrder: order,
-		Headers:     headers,
-		Path:        r.URL.Path,
-		Method:      r.Method,
-		Ts:          float64(time.Now().UnixMilli()),
+		IP:              extractIP(r),
+		UserAgent:       r.Header.Get("User-Agent"),
+		HeaderOrder:     order,
+		Headers:         headers,
+		Path:            r.URL.Path,
+		Method:          r.Method,
+		Ts:              float64(time.Now().UnixMilli()),
+		JA3:             tlsFP.JA3,
+		JA3Hash:         tlsFP.JA3Hash,
+		JA4:             tlsFP.JA4,
+		H2SettingsOrder: tlsFP.H2SettingsOrder,
+		H2WindowUpdate:  tlsFP.H2WindowUpdate,
 	}
 }
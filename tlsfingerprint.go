@@ -0,0 +1,541 @@
+package bbloker
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TLSFingerprint is the passive fingerprint captured from a connection's TLS
+// ClientHello (JA3/JA4) and, once negotiated, its HTTP/2 preface (the
+// "Akamai" SETTINGS/WINDOW_UPDATE fingerprint). Unlike UA or header checks,
+// none of these fields are under the client's easy control without
+// reimplementing its TLS/H2 stack, which is what makes them effective
+// against curl-impersonate, headless Chromium, and scraping frameworks.
+type TLSFingerprint struct {
+	JA3     string
+	JA3Hash string
+	JA4     string
+
+	H2SettingsOrder []uint16 // SETTINGS identifiers, in the order the client sent them
+	H2WindowUpdate  uint32   // the client's initial connection-level WINDOW_UPDATE increment
+}
+
+// h2Fingerprint renders the Akamai-style HTTP/2 fingerprint string used to
+// match against RuleSet.BlockedH2Fingerprints: SETTINGS identifiers in
+// client order, joined by "-", then the WINDOW_UPDATE increment.
+func (f TLSFingerprint) h2Fingerprint() string {
+	if len(f.H2SettingsOrder) == 0 && f.H2WindowUpdate == 0 {
+		return ""
+	}
+	parts := make([]string, len(f.H2SettingsOrder))
+	for i, id := range f.H2SettingsOrder {
+		parts[i] = strconv.Itoa(int(id))
+	}
+	return strings.Join(parts, "-") + "|" + strconv.Itoa(int(f.H2WindowUpdate))
+}
+
+type tlsFingerprintContextKey struct{}
+
+// FingerprintFromContext returns the TLSFingerprint captured for the
+// request's underlying connection, if the server was configured with
+// WrapTLSListener and ConnContext.
+func FingerprintFromContext(ctx context.Context) (TLSFingerprint, bool) {
+	fp, ok := ctx.Value(tlsFingerprintContextKey{}).(*TLSFingerprint)
+	if !ok || fp == nil {
+		return TLSFingerprint{}, false
+	}
+	return *fp, true
+}
+
+// ConnContext attaches c's captured TLSFingerprint (if any) to ctx. Set it
+// as http.Server.ConnContext when serving over a listener returned by
+// WrapTLSListener. c is unwrapped as needed: http.Server hands ConnContext
+// whatever its listener's Accept returned, which for a TLS listener is the
+// *tls.Conn wrapping our capturing conn, not the capturing conn itself.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	var fp *TLSFingerprint
+	switch cc := c.(type) {
+	case *h2CaptureConn:
+		fp = cc.fp
+	case *tls.Conn:
+		if raw, ok := cc.NetConn().(*capturingConn); ok {
+			fp = raw.fingerprint()
+		}
+	case *capturingConn:
+		fp = cc.fingerprint()
+	}
+	if fp == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tlsFingerprintContextKey{}, fp)
+}
+
+// WrapListener returns a net.Listener whose connections capture their raw
+// TLS ClientHello (for JA3/JA4), read passively off the wire ahead of the
+// standard library's own TLS handshake, which still sees the same bytes via
+// the returned conn's Read method. The ClientHello is only legible here,
+// before tls.Conn decrypts the stream — which is also why this listener
+// cannot capture the HTTP/2 preface (it arrives encrypted); use
+// WrapTLSListener, which applies this wrapper itself, rather than calling
+// this directly unless you only need JA3/JA4.
+func WrapListener(inner net.Listener) net.Listener {
+	return &tlsListener{Listener: inner}
+}
+
+// WrapTLSListener wraps inner to terminate TLS with config and capture a
+// full TLSFingerprint: the ClientHello (JA3/JA4) below the handshake via
+// WrapListener, and, for clients that negotiate HTTP/2, the decrypted
+// preface and first SETTINGS/WINDOW_UPDATE frames above it. The two halves
+// can't share one raw-socket conn — the ClientHello is only legible before
+// decryption and the H2 preface only after it — so this does the TLS
+// termination itself; don't additionally wrap the result (or the listener
+// passed to http.Server.ServeTLS/ListenAndServeTLS) in tls.NewListener.
+// Pair this with ConnContext as http.Server's ConnContext hook, and use
+// Bbloker.HandlerWithTLS instead of Handler to fold the fingerprint into
+// Analyze's decision.
+func WrapTLSListener(inner net.Listener, config *tls.Config) net.Listener {
+	return &h2CaptureListener{Listener: tls.NewListener(WrapListener(inner), config)}
+}
+
+type tlsListener struct {
+	net.Listener
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &capturingConn{Conn: conn}, nil
+}
+
+// capturingConn wraps a net.Conn, inspecting the bytes its first Read
+// returns without altering them, parsing them as a TLS ClientHello record
+// (for JA3/JA4). The real TLS stack reading through this conn sees an
+// untouched stream throughout.
+type capturingConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	fp       *TLSFingerprint
+	captured bool
+}
+
+// maxH2PrefaceAttempts bounds how many Reads h2CaptureConn inspects for
+// the HTTP/2 preface before giving up. Those Reads return decrypted
+// application data only (tls.Conn consumes handshake records itself), and
+// each is matched on its own, so the preface and the first SETTINGS frame
+// must arrive within a single Read to be captured.
+const maxH2PrefaceAttempts = 20
+
+func (c *capturingConn) fingerprint() *TLSFingerprint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fp == nil {
+		c.fp = &TLSFingerprint{}
+	}
+	return c.fp
+}
+
+func (c *capturingConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	captured := c.captured
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(p)
+	if !captured && n > 0 {
+		c.captureClientHello(p[:n])
+	}
+	return n, err
+}
+
+func (c *capturingConn) captureClientHello(data []byte) {
+	if hello, err := parseClientHello(data); err == nil {
+		fp := c.fingerprint()
+		ja3, ja3Hash := computeJA3(hello)
+		fp.JA3, fp.JA3Hash = ja3, ja3Hash
+		fp.JA4 = computeJA4(hello)
+	}
+	c.mu.Lock()
+	c.captured = true
+	c.mu.Unlock()
+}
+
+// h2CaptureListener terminates TLS over its inner (already ClientHello-
+// capturing) listener and wraps each accepted *tls.Conn so its decrypted
+// stream can be inspected for the HTTP/2 preface.
+type h2CaptureListener struct {
+	net.Listener
+}
+
+func (l *h2CaptureListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := conn.(*tls.Conn)
+	var fp *TLSFingerprint
+	if raw, ok := tc.NetConn().(*capturingConn); ok {
+		fp = raw.fingerprint()
+	}
+	return &h2CaptureConn{Conn: tc, fp: fp}, nil
+}
+
+// h2CaptureConn wraps the *tls.Conn terminating TLS, inspecting each Read's
+// decrypted bytes for the client's HTTP/2 preface and first SETTINGS/
+// WINDOW_UPDATE frames, writing them into the same TLSFingerprint that the
+// raw-socket capturingConn below it populated with the ClientHello. The
+// real HTTP/2 stack reading through this conn sees an untouched stream
+// throughout.
+type h2CaptureConn struct {
+	*tls.Conn
+
+	mu         sync.Mutex
+	fp         *TLSFingerprint
+	done       bool
+	h2Attempts int
+}
+
+func (c *h2CaptureConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(p)
+	if !done && n > 0 {
+		c.captureH2Preface(p[:n])
+	}
+	return n, err
+}
+
+func (c *h2CaptureConn) captureH2Preface(data []byte) {
+	order, windowUpdate, ok := parseH2Preface(data)
+	if ok && c.fp != nil {
+		c.mu.Lock()
+		c.fp.H2SettingsOrder = order
+		c.fp.H2WindowUpdate = windowUpdate
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.h2Attempts++
+	if ok || c.h2Attempts >= maxH2PrefaceAttempts {
+		c.done = true
+	}
+	c.mu.Unlock()
+}
+
+// --- ClientHello parsing and JA3/JA4 ---
+
+type clientHelloInfo struct {
+	Version        uint16
+	CipherSuites   []uint16
+	Extensions     []uint16
+	EllipticCurves []uint16
+	ECPointFormats []uint8
+	ALPN           []string
+	HasSNI         bool
+}
+
+// parseClientHello parses a single TLS record containing a ClientHello
+// handshake message. It only handles the common case of the ClientHello
+// fitting in one record, which covers the overwhelming majority of clients.
+func parseClientHello(data []byte) (*clientHelloInfo, error) {
+	if len(data) < 9 || data[0] != 0x16 {
+		return nil, fmt.Errorf("bbloker: not a TLS handshake record")
+	}
+	recordLen := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data) < 5+recordLen {
+		return nil, fmt.Errorf("bbloker: truncated TLS record")
+	}
+	body := data[5 : 5+recordLen]
+
+	if len(body) < 4 || body[0] != 0x01 {
+		return nil, fmt.Errorf("bbloker: not a ClientHello")
+	}
+	hsLen := int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+	if len(body) < 4+hsLen {
+		return nil, fmt.Errorf("bbloker: truncated ClientHello")
+	}
+	msg := body[4 : 4+hsLen]
+
+	r := &byteReader{data: msg}
+	version, ok := r.uint16()
+	if !ok {
+		return nil, fmt.Errorf("bbloker: short ClientHello")
+	}
+	r.skip(32) // random
+	sessionIDLen, ok := r.uint8()
+	if !ok || !r.skip(int(sessionIDLen)) {
+		return nil, fmt.Errorf("bbloker: short ClientHello")
+	}
+
+	cipherSuitesLen, ok := r.uint16()
+	if !ok {
+		return nil, fmt.Errorf("bbloker: short ClientHello")
+	}
+	cipherBytes, ok := r.bytes(int(cipherSuitesLen))
+	if !ok {
+		return nil, fmt.Errorf("bbloker: short ClientHello")
+	}
+	var ciphers []uint16
+	for i := 0; i+1 < len(cipherBytes); i += 2 {
+		ciphers = append(ciphers, binary.BigEndian.Uint16(cipherBytes[i:i+2]))
+	}
+
+	compressionLen, ok := r.uint8()
+	if !ok || !r.skip(int(compressionLen)) {
+		return nil, fmt.Errorf("bbloker: short ClientHello")
+	}
+
+	info := &clientHelloInfo{Version: version, CipherSuites: ciphers}
+
+	if r.remaining() < 2 {
+		return info, nil // no extensions
+	}
+	extTotalLen, _ := r.uint16()
+	extBytes, ok := r.bytes(int(extTotalLen))
+	if !ok {
+		return info, nil
+	}
+	er := &byteReader{data: extBytes}
+	for er.remaining() >= 4 {
+		extType, _ := er.uint16()
+		extLen, _ := er.uint16()
+		extData, ok := er.bytes(int(extLen))
+		if !ok {
+			break
+		}
+		info.Extensions = append(info.Extensions, extType)
+		switch extType {
+		case 0: // server_name
+			info.HasSNI = len(extData) > 0
+		case 10: // supported_groups / elliptic_curves
+			gr := &byteReader{data: extData}
+			if n, ok := gr.uint16(); ok {
+				if groupBytes, ok := gr.bytes(int(n)); ok {
+					for i := 0; i+1 < len(groupBytes); i += 2 {
+						info.EllipticCurves = append(info.EllipticCurves, binary.BigEndian.Uint16(groupBytes[i:i+2]))
+					}
+				}
+			}
+		case 11: // ec_point_formats
+			pr := &byteReader{data: extData}
+			if n, ok := pr.uint8(); ok {
+				if ptBytes, ok := pr.bytes(int(n)); ok {
+					info.ECPointFormats = append(info.ECPointFormats, ptBytes...)
+				}
+			}
+		case 16: // application_layer_protocol_negotiation
+			ar := &byteReader{data: extData}
+			if n, ok := ar.uint16(); ok {
+				if protoBytes, ok := ar.bytes(int(n)); ok {
+					pr2 := &byteReader{data: protoBytes}
+					for pr2.remaining() > 0 {
+						l, ok := pr2.uint8()
+						if !ok {
+							break
+						}
+						proto, ok := pr2.bytes(int(l))
+						if !ok {
+							break
+						}
+						info.ALPN = append(info.ALPN, string(proto))
+					}
+				}
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// byteReader is a minimal cursor over a byte slice for TLS field parsing.
+type byteReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *byteReader) remaining() int { return len(r.data) - r.pos }
+
+func (r *byteReader) uint8() (uint8, bool) {
+	if r.remaining() < 1 {
+		return 0, false
+	}
+	v := r.data[r.pos]
+	r.pos++
+	return v, true
+}
+
+func (r *byteReader) uint16() (uint16, bool) {
+	if r.remaining() < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(r.data[r.pos : r.pos+2])
+	r.pos += 2
+	return v, true
+}
+
+func (r *byteReader) bytes(n int) ([]byte, bool) {
+	if n < 0 || r.remaining() < n {
+		return nil, false
+	}
+	v := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return v, true
+}
+
+func (r *byteReader) skip(n int) bool {
+	_, ok := r.bytes(n)
+	return ok
+}
+
+// computeJA3 renders the JA3 string (TLSVersion,Ciphers,Extensions,Curves,
+// PointFormats, each "-"-joined) and its MD5 hash, per the original JA3
+// spec (Salesforce, 2017).
+func computeJA3(h *clientHelloInfo) (ja3 string, ja3Hash string) {
+	ja3 = strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinUint16(h.CipherSuites),
+		joinUint16(h.Extensions),
+		joinUint16(h.EllipticCurves),
+		joinUint8(h.ECPointFormats),
+	}, ",")
+	sum := md5.Sum([]byte(ja3))
+	return ja3, hex.EncodeToString(sum[:])
+}
+
+// computeJA4 renders a JA4 fingerprint in the "t13d1516h2_<ciphers>_<exts>"
+// layout: protocol ('t' for TCP/TLS), TLS version, SNI presence ('d' domain
+// present, 'i' no SNI), 2-digit cipher count, 2-digit extension count, the
+// first+last characters of the first offered ALPN protocol (or "00"), then
+// truncated SHA256 digests of the sorted cipher and extension lists.
+func computeJA4(h *clientHelloInfo) string {
+	sniFlag := "i"
+	if h.HasSNI {
+		sniFlag = "d"
+	}
+	alpn := "00"
+	if len(h.ALPN) > 0 && len(h.ALPN[0]) > 0 {
+		first := h.ALPN[0]
+		alpn = string(first[0]) + string(first[len(first)-1])
+	}
+
+	a := fmt.Sprintf("t%s%s%02d%02d%s",
+		ja4Version(h.Version), sniFlag, capAt99(len(h.CipherSuites)), capAt99(len(h.Extensions)), alpn)
+
+	b := truncatedSHA256(sortedHex16(h.CipherSuites))
+	c := truncatedSHA256(sortedHex16(h.Extensions))
+
+	return a + "_" + b + "_" + c
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	default:
+		return "00"
+	}
+}
+
+func capAt99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
+
+func sortedHex16(values []uint16) string {
+	sorted := append([]uint16(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, len(sorted))
+	for i, v := range sorted {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func truncatedSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinUint16(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinUint8(values []uint8) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+// --- HTTP/2 SETTINGS/WINDOW_UPDATE ("Akamai") fingerprint ---
+
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// parseH2Preface parses the client connection preface followed by its
+// first SETTINGS frame and an optional WINDOW_UPDATE frame, returning the
+// SETTINGS identifiers in the order sent and the WINDOW_UPDATE increment.
+func parseH2Preface(data []byte) (order []uint16, windowUpdate uint32, ok bool) {
+	if !strings.HasPrefix(string(data), http2Preface) {
+		return nil, 0, false
+	}
+	rest := data[len(http2Preface):]
+
+	for len(rest) >= 9 {
+		length := int(rest[0])<<16 | int(rest[1])<<8 | int(rest[2])
+		frameType := rest[3]
+		if len(rest) < 9+length {
+			break
+		}
+		payload := rest[9 : 9+length]
+
+		switch frameType {
+		case 0x04: // SETTINGS
+			for i := 0; i+6 <= len(payload); i += 6 {
+				order = append(order, binary.BigEndian.Uint16(payload[i:i+2]))
+			}
+		case 0x08: // WINDOW_UPDATE
+			if len(payload) >= 4 {
+				windowUpdate = binary.BigEndian.Uint32(payload[:4]) &^ (1 << 31)
+			}
+		}
+
+		rest = rest[9+length:]
+		// The Akamai fingerprint only considers the first SETTINGS
+		// frame; stop once we've captured it (and a following
+		// WINDOW_UPDATE, if any arrived in the same read).
+		if frameType == 0x04 && (windowUpdate != 0 || len(rest) < 9 || rest[3] != 0x08) {
+			break
+		}
+		if frameType == 0x08 && len(order) > 0 {
+			break
+		}
+	}
+
+	return order, windowUpdate, len(order) > 0
+}
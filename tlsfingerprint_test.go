@@ -0,0 +1,145 @@
+package bbloker
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// buildClientHelloRecord assembles a single-record TLS ClientHello (version
+// 0x0303, two cipher suites, no compression, and server_name/
+// supported_groups/ec_point_formats/ALPN extensions offering "h2" then
+// "http/1.1") so parseClientHello/computeJA3 can be exercised against a
+// known, fully-specified input.
+func buildClientHelloRecord() []byte {
+	exts := []byte{}
+	appendExt := func(typ uint16, data []byte) {
+		var hdr [4]byte
+		binary.BigEndian.PutUint16(hdr[0:2], typ)
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(len(data)))
+		exts = append(exts, hdr[:]...)
+		exts = append(exts, data...)
+	}
+	appendExt(0, []byte{0x00, 0x00, 0x00})                                                          // server_name (content unused beyond len>0)
+	appendExt(10, []byte{0x00, 0x04, 0x00, 0x1d, 0x00, 0x17})                                       // supported_groups: x25519, secp256r1
+	appendExt(11, []byte{0x01, 0x00})                                                               // ec_point_formats: uncompressed
+	appendExt(16, []byte{0x00, 0x0c, 0x02, 'h', '2', 0x08, 'h', 't', 't', 'p', '/', '1', '.', '1'}) // ALPN: h2, http/1.1
+
+	msg := []byte{}
+	msg = append(msg, 0x03, 0x03)                         // client_version
+	msg = append(msg, make([]byte, 32)...)                // random
+	msg = append(msg, 0x00)                               // session_id length
+	msg = append(msg, 0x00, 0x04, 0x13, 0x01, 0x13, 0x02) // cipher_suites: TLS_AES_128_GCM_SHA256, TLS_AES_256_GCM_SHA384
+	msg = append(msg, 0x01, 0x00)                         // compression_methods: null
+	var extLenBuf [2]byte
+	binary.BigEndian.PutUint16(extLenBuf[:], uint16(len(exts)))
+	msg = append(msg, extLenBuf[:]...)
+	msg = append(msg, exts...)
+
+	body := []byte{0x01, byte(len(msg) >> 16), byte(len(msg) >> 8), byte(len(msg))}
+	body = append(body, msg...)
+
+	record := []byte{0x16, 0x03, 0x01}
+	var recLenBuf [2]byte
+	binary.BigEndian.PutUint16(recLenBuf[:], uint16(len(body)))
+	record = append(record, recLenBuf[:]...)
+	record = append(record, body...)
+	return record
+}
+
+func TestParseClientHelloAndJA3(t *testing.T) {
+	hello, err := parseClientHello(buildClientHelloRecord())
+	if err != nil {
+		t.Fatalf("parseClientHello: %v", err)
+	}
+
+	if hello.Version != 0x0303 {
+		t.Errorf("Version = %#04x, want 0x0303", hello.Version)
+	}
+	wantCiphers := []uint16{0x1301, 0x1302}
+	if !equalUint16(hello.CipherSuites, wantCiphers) {
+		t.Errorf("CipherSuites = %v, want %v", hello.CipherSuites, wantCiphers)
+	}
+	wantExtensions := []uint16{0, 10, 11, 16}
+	if !equalUint16(hello.Extensions, wantExtensions) {
+		t.Errorf("Extensions = %v, want %v", hello.Extensions, wantExtensions)
+	}
+	wantCurves := []uint16{0x001d, 0x0017}
+	if !equalUint16(hello.EllipticCurves, wantCurves) {
+		t.Errorf("EllipticCurves = %v, want %v", hello.EllipticCurves, wantCurves)
+	}
+	if !hello.HasSNI {
+		t.Error("HasSNI = false, want true")
+	}
+	wantALPN := []string{"h2", "http/1.1"}
+	if len(hello.ALPN) != len(wantALPN) || hello.ALPN[0] != wantALPN[0] || hello.ALPN[1] != wantALPN[1] {
+		t.Errorf("ALPN = %v, want %v", hello.ALPN, wantALPN)
+	}
+
+	ja3, ja3Hash := computeJA3(hello)
+	wantJA3 := "771,4865-4866,0-10-11-16,29-23,0"
+	if ja3 != wantJA3 {
+		t.Errorf("JA3 = %q, want %q", ja3, wantJA3)
+	}
+	sum := md5.Sum([]byte(wantJA3))
+	wantHash := hex.EncodeToString(sum[:])
+	if ja3Hash != wantHash {
+		t.Errorf("JA3Hash = %q, want %q", ja3Hash, wantHash)
+	}
+
+	ja4 := computeJA4(hello)
+	wantJA4Prefix := "t12d0204h2_"
+	if len(ja4) < len(wantJA4Prefix) || ja4[:len(wantJA4Prefix)] != wantJA4Prefix {
+		t.Errorf("JA4 = %q, want prefix %q", ja4, wantJA4Prefix)
+	}
+}
+
+func equalUint16(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseH2Preface(t *testing.T) {
+	settings := []byte{
+		0x00, 0x03, // id 3
+		0x00, 0x00, 0x00, 0x64, // value 100
+		0x00, 0x04, // id 4
+		0x00, 0x0f, 0xff, 0xff, // value 0x0fffff
+	}
+	settingsFrame := append([]byte{
+		byte(len(settings) >> 16), byte(len(settings) >> 8), byte(len(settings)),
+		0x04,                   // type: SETTINGS
+		0x00,                   // flags
+		0x00, 0x00, 0x00, 0x00, // stream id
+	}, settings...)
+
+	windowUpdatePayload := []byte{0x00, 0x0f, 0x00, 0x00} // increment 0x000f0000
+	windowUpdateFrame := append([]byte{
+		0x00, 0x00, 0x04, // length 4
+		0x08,                   // type: WINDOW_UPDATE
+		0x00,                   // flags
+		0x00, 0x00, 0x00, 0x00, // stream id
+	}, windowUpdatePayload...)
+
+	data := append([]byte(http2Preface), append(settingsFrame, windowUpdateFrame...)...)
+
+	order, windowUpdate, ok := parseH2Preface(data)
+	if !ok {
+		t.Fatal("parseH2Preface: ok = false, want true")
+	}
+	wantOrder := []uint16{0x0003, 0x0004}
+	if !equalUint16(order, wantOrder) {
+		t.Errorf("order = %v, want %v", order, wantOrder)
+	}
+	if windowUpdate != 0x000f0000 {
+		t.Errorf("windowUpdate = %#x, want %#x", windowUpdate, 0x000f0000)
+	}
+}
@@ -0,0 +1,71 @@
+package bbloker
+
+import "net/netip"
+
+// ipTrie is a binary trie over the 128-bit representation of an address
+// (IPv4 addresses are mapped into their 4-in-6 form via netip.Addr.As16, so
+// a single trie serves both families). Insertion marks the node at the end
+// of a prefix as a leaf; lookup walks the trie bit by bit and reports the
+// most specific leaf seen along the way, which is the usual way to get
+// O(prefix length) membership tests over millions of CIDR entries instead of
+// a linear scan.
+type ipTrie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	children [2]*trieNode
+	isLeaf   bool
+	source   string
+}
+
+// insert adds prefix to the trie, tagging matches against it with source.
+func (t *ipTrie) insert(prefix netip.Prefix, source string) {
+	addr, bits := prefixBits(prefix)
+	n := &t.root
+	for i := 0; i < bits; i++ {
+		bit := bitAt(addr, i)
+		child := n.children[bit]
+		if child == nil {
+			child = &trieNode{}
+			n.children[bit] = child
+		}
+		n = child
+	}
+	n.isLeaf = true
+	n.source = source
+}
+
+// lookup reports whether ip falls within any inserted prefix, and the
+// source tag of the most specific match.
+func (t *ipTrie) lookup(ip netip.Addr) (matched bool, source string) {
+	addr := ip.As16()
+	n := &t.root
+	if n.isLeaf {
+		matched, source = true, n.source
+	}
+	for i := 0; i < 128; i++ {
+		n = n.children[bitAt(addr, i)]
+		if n == nil {
+			break
+		}
+		if n.isLeaf {
+			matched, source = true, n.source
+		}
+	}
+	return matched, source
+}
+
+// prefixBits returns the 4-in-6 byte representation of prefix's address and
+// the number of significant bits within that 128-bit space.
+func prefixBits(prefix netip.Prefix) ([16]byte, int) {
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+	return prefix.Addr().As16(), bits
+}
+
+func bitAt(addr [16]byte, i int) byte {
+	return (addr[i/8] >> uint(7-i%8)) & 1
+}